@@ -0,0 +1,67 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// boxNonceSize is the nacl/box nonce size, in bytes.
+const boxNonceSize = 24
+
+// BoxSeal encrypts pt for recipient's curve25519 public key, authenticated
+// as having come from sender, using nacl/box with a freshly generated
+// nonce (returned alongside the ciphertext). This is the primitive for
+// sharing an encrypted secret directly between two users, without either
+// of them learning the other's master key.
+func (e *Engine) BoxSeal(pt []byte, recipient [32]byte,
+	sender EncryptionKeyPair) (ct, nonce []byte, err error) {
+
+	priv, err := e.Unseal(sender.Private, sender.PNonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var privArr [32]byte
+	copy(privArr[:], priv)
+
+	var n [boxNonceSize]byte
+	if _, err := rand.Read(n[:]); err != nil {
+		return nil, nil, err
+	}
+
+	ct = box.Seal(nil, pt, &n, &recipient, &privArr)
+	return ct, n[:], nil
+}
+
+// BoxOpen decrypts ct and nonce, as produced by BoxSeal from sender's
+// private key to recipient's public key.
+func (e *Engine) BoxOpen(ct, nonce []byte, sender [32]byte,
+	recipient EncryptionKeyPair) ([]byte, error) {
+
+	priv, err := e.Unseal(recipient.Private, recipient.PNonce)
+	if err != nil {
+		return nil, err
+	}
+
+	var privArr [32]byte
+	copy(privArr[:], priv)
+
+	var n [boxNonceSize]byte
+	copy(n[:], nonce)
+
+	pt, ok := box.Open(nil, ct, &n, &sender, &privArr)
+	if !ok {
+		return nil, errors.New("crypto: box authentication failed")
+	}
+
+	return pt, nil
+}
+
+// SealedBoxSeal encrypts pt for recipient using an ephemeral, anonymous
+// sender keypair that's discarded after use, so the caller doesn't need a
+// key of their own to share a secret with recipient.
+func (e *Engine) SealedBoxSeal(pt []byte, recipient [32]byte) ([]byte, error) {
+	return box.SealAnonymous(nil, pt, &recipient, rand.Reader)
+}
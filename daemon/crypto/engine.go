@@ -2,16 +2,23 @@
 package crypto
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
 	"encoding/json"
+	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/dchest/blake2b"
 	triplesec "github.com/keybase/go-triplesec"
 	"golang.org/x/crypto/ed25519"
 	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 
 	"github.com/arigatomachine/cli/daemon/base64"
+	"github.com/arigatomachine/cli/daemon/crypto/ledger"
+	"github.com/arigatomachine/cli/daemon/crypto/sshagent"
 	"github.com/arigatomachine/cli/daemon/db"
 	"github.com/arigatomachine/cli/daemon/envelope"
 	"github.com/arigatomachine/cli/daemon/identity"
@@ -24,15 +31,50 @@ const (
 	blakeSize = 16
 )
 
+// Key types a SignatureKeyPair's Type can hold, identifying where its
+// private material lives and how Engine.Sign must obtain a signature
+// from it.
+const (
+	// KeyTypeLocal is the default: the private key is sealed with
+	// triplesec under the user's master key, as it always was before
+	// Type existed.
+	KeyTypeLocal = "local"
+
+	// KeyTypeLedger signs via an attached Ledger hardware wallet.
+	KeyTypeLedger = "ledger"
+
+	// KeyTypeOffline has no signer Torus can reach; signing returns
+	// ErrOfflineSign so the caller can gather a detached signature out
+	// of band.
+	KeyTypeOffline = "offline"
+
+	// KeyTypeAgent signs by delegating to a running ssh-agent.
+	KeyTypeAgent = "agent"
+)
+
 // SignatureKeyPair is an ed25519/eddsa digital signature keypair.
-// The private portion of the keypair is encrypted with triplesec.
 //
-// PNonce contains the nonce used when deriving the password used to encrypt
-// the private portion.
+// For a KeyTypeLocal pair (the default, and the only kind that existed
+// before Type was added) the private portion is encrypted with
+// triplesec, and PNonce contains the nonce used when deriving the
+// password used to encrypt it. A KeyTypeLedger pair stores no private
+// material at all -- Path holds the BIP32 derivation path and signing is
+// delegated to the device. A KeyTypeOffline pair stores neither; Engine
+// knows only its public key. A KeyTypeAgent pair likewise stores only
+// the public key, and signing is delegated to a running ssh-agent.
 type SignatureKeyPair struct {
 	Public  ed25519.PublicKey
 	Private []byte
 	PNonce  []byte
+
+	// Type is one of the KeyType* constants. The zero value, "", is
+	// treated as KeyTypeLocal for compatibility with keys stored before
+	// this field existed.
+	Type string
+
+	// Path is the BIP32 derivation path for a KeyTypeLedger pair. Unused
+	// otherwise.
+	Path string
 }
 
 // EncryptionKeyPair is a curve25519 encryption keypair.
@@ -48,6 +90,12 @@ type EncryptionKeyPair struct {
 
 // KeyPairs contains a signature and an encryption keypair for a user.
 type KeyPairs struct {
+	// ID is the identity this KeyPairs is stored under in the DB. It's
+	// assigned by the caller when the KeyPairs is first persisted, and
+	// is what RotateMasterKey uses to write each re-sealed KeyPairs back
+	// to its own record rather than the session's.
+	ID identity.ID
+
 	Signature  SignatureKeyPair
 	Encryption EncryptionKeyPair
 }
@@ -65,32 +113,55 @@ func NewEngine(sess session.Session, db *db.DB) *Engine {
 }
 
 // Seal encrypts the plaintext pt bytes with triplesec-v3 using a key derrived
-// via blake2b from the user's master key and a nonce (returned).
+// via blake2b from the user's master key and a nonce (returned). The
+// returned ciphertext is prefixed with a keyVersionCurrent byte, so
+// Unseal can tell it apart from a legacy, unprefixed blob.
 func (e *Engine) Seal(pt []byte) ([]byte, []byte, error) {
 	mk, err := e.unsealMasterKey()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	nonce := make([]byte, nonceSize)
-	_, err = rand.Read(nonce)
+	return sealWithKey(pt, mk)
+}
+
+// Unseal decrypts the ciphertext ct, encrypted with triplesec-v3, using the
+// a key derrived via blake2b from the user's master key and the provided nonce.
+// It accepts both current blobs (prefixed with keyVersionCurrent, as Seal
+// produces) and legacy blobs sealed before key versioning existed.
+func (e *Engine) Unseal(ct, nonce []byte) ([]byte, error) {
+	mk, err := e.unsealMasterKey()
 	if err != nil {
+		return nil, err
+	}
+
+	return unsealWithKey(ct, nonce, mk)
+}
+
+// sealWithKey is Seal, parameterized on an explicit master key instead of
+// fetching the user's current one -- used by RotateMasterKey, which needs
+// to seal under a master key other than whatever's currently stored.
+func sealWithKey(pt, mk []byte) ([]byte, []byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
 		return nil, nil, err
 	}
 
 	dk := deriveKey(mk, nonce)
 	ts := newTriplesec(dk)
 	ct, err := ts.Encrypt(pt)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return ct, nonce, err
+	return append([]byte{keyVersionCurrent}, ct...), nonce, nil
 }
 
-// Unseal decrypts the ciphertext ct, encrypted with triplesec-v3, using the
-// a key derrived via blake2b from the user's master key and the provided nonce.
-func (e *Engine) Unseal(ct, nonce []byte) ([]byte, error) {
-	mk, err := e.unsealMasterKey()
-	if err != nil {
-		return nil, err
+// unsealWithKey is Unseal, parameterized on an explicit master key. See
+// sealWithKey.
+func unsealWithKey(ct, nonce, mk []byte) ([]byte, error) {
+	if len(ct) > 0 && ct[0] == keyVersionCurrent {
+		ct = ct[1:]
 	}
 
 	dk := deriveKey(mk, nonce)
@@ -135,20 +206,206 @@ func (e *Engine) GenerateKeyPairs() (*KeyPairs, error) {
 	return kp, nil
 }
 
-// Sign signs b bytes using the provided Sealed ed25519 keypair.
-func (e *Engine) Sign(s SignatureKeyPair, b []byte) ([]byte, error) {
-	pk, err := e.Unseal(s.Private, s.PNonce)
+// CreateLedgerSignatureKey derives an ed25519 signing key at path on the
+// attached Ledger device and records it as a ledger-backed
+// SignatureKeyPair. Only the derivation path and public key are stored;
+// the private key never leaves the device.
+func (e *Engine) CreateLedgerSignatureKey(path string) (*SignatureKeyPair, error) {
+	dev, err := ledger.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer dev.Close()
+
+	pub, err := dev.PublicKey()
 	if err != nil {
 		return nil, err
 	}
 
-	return ed25519.Sign(pk, b), nil
+	return &SignatureKeyPair{
+		Public: pub,
+		Type:   KeyTypeLedger,
+		Path:   path,
+	}, nil
+}
+
+// ImportFromSSHAgent finds an ed25519 key in the running ssh-agent whose
+// comment or fingerprint matches id, and records it as an agent-backed
+// SignatureKeyPair. No private material is sealed locally; signing is
+// delegated to the agent for as long as it holds the key.
+func (e *Engine) ImportFromSSHAgent(id string) (*SignatureKeyPair, error) {
+	ag, err := sshagent.Dial()
+	if err != nil {
+		return nil, err
+	}
+
+	_, pub, err := sshagent.FindEd25519Key(ag, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignatureKeyPair{
+		Public: pub,
+		Type:   KeyTypeAgent,
+	}, nil
+}
+
+// InstallToSSHAgent unseals kp's local private key and loads it into the
+// running ssh-agent for lifetime, so the user can keep their Torus key
+// hot -- signed into the agent and reachable via ImportFromSSHAgent --
+// without re-entering their passphrase for every operation.
+func (e *Engine) InstallToSSHAgent(kp *SignatureKeyPair, lifetime time.Duration) error {
+	if kp.Type != "" && kp.Type != KeyTypeLocal {
+		return fmt.Errorf("crypto: cannot install a %s key into ssh-agent", kp.Type)
+	}
+
+	priv, err := e.Unseal(kp.Private, kp.PNonce)
+	if err != nil {
+		return err
+	}
+
+	ag, err := sshagent.Dial()
+	if err != nil {
+		return err
+	}
+
+	comment := fmt.Sprintf("torus:%s [expires %s]",
+		e.sess.ID(), time.Now().Add(lifetime).Format(time.RFC3339))
+
+	return ag.Add(agent.AddedKey{
+		PrivateKey:   ed25519.PrivateKey(priv),
+		Comment:      comment,
+		LifetimeSecs: uint32(lifetime.Seconds()),
+	})
+}
+
+// agentSigner is a Signer that delegates to a key held by a running
+// ssh-agent.
+type agentSigner struct {
+	ag  agent.Agent
+	pub ed25519.PublicKey
+}
+
+func (s *agentSigner) Public() PublicKey {
+	return ed25519PublicKey(s.pub)
+}
+
+func (s *agentSigner) Sign(msg []byte) (string, []byte, error) {
+	sshPub, err := ssh.NewPublicKey(s.pub)
+	if err != nil {
+		return "", nil, err
+	}
+
+	sig, err := s.ag.Sign(sshPub, msg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return EdDSA, sig.Blob, nil
+}
+
+// ErrOfflineSign is returned by Engine.Sign when asked to sign with a
+// KeyTypeOffline SignatureKeyPair. Torus has no access to the private
+// key, so the caller must produce a detached signature over Bytes out of
+// band (e.g. on an air-gapped machine) and inject it into the pending
+// request itself.
+type ErrOfflineSign struct {
+	Bytes []byte
+}
+
+func (e *ErrOfflineSign) Error() string {
+	return "crypto: key is offline; sign Bytes out of band and supply the detached signature"
+}
+
+// ledgerSigner is a Signer that forwards signing to an attached Ledger
+// device, which prompts the user for on-device confirmation.
+type ledgerSigner struct {
+	dev *ledger.Device
+	pub ed25519.PublicKey
+}
+
+func (s *ledgerSigner) Public() PublicKey {
+	return ed25519PublicKey(s.pub)
+}
+
+func (s *ledgerSigner) Sign(msg []byte) (string, []byte, error) {
+	sig, err := s.dev.Sign(msg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return EdDSA, sig, nil
+}
+
+// Sign signs b bytes using the provided SignatureKeyPair. Local keys are
+// unsealed with the user's master key; Ledger keys are forwarded to the
+// device and require on-device confirmation; offline keys can't be
+// signed with here at all, and Sign returns an *ErrOfflineSign instead.
+func (e *Engine) Sign(s SignatureKeyPair, b []byte) ([]byte, error) {
+	_, sig, err := e.sign(s, b)
+	return sig, err
+}
+
+// sign dispatches to the Signer appropriate for s.Type and signs b with
+// it, returning the algorithm used alongside the signature. It's the
+// shared implementation behind both Sign and SignedEnvelope, so every
+// signing path -- local, Ledger, ssh-agent, or offline -- is reachable
+// the same way regardless of caller.
+func (e *Engine) sign(s SignatureKeyPair, b []byte) (string, []byte, error) {
+	if s.Type == KeyTypeOffline {
+		return "", nil, &ErrOfflineSign{Bytes: b}
+	}
+
+	signer, err := e.signerFor(s)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return signer.Sign(b)
+}
+
+// signerFor returns the Signer appropriate for s.Type. KeyTypeOffline is
+// handled by the caller, since it doesn't produce a Signer at all.
+func (e *Engine) signerFor(s SignatureKeyPair) (Signer, error) {
+	switch s.Type {
+	case "", KeyTypeLocal:
+		return e.NewSigner(s), nil
+	case KeyTypeLedger:
+		dev, err := ledger.Open(s.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ledgerSigner{dev: dev, pub: s.Public}, nil
+	case KeyTypeAgent:
+		ag, err := sshagent.Dial()
+		if err != nil {
+			return nil, err
+		}
+
+		return &agentSigner{ag: ag, pub: s.Public}, nil
+	default:
+		return nil, fmt.Errorf("crypto: unknown key type %q", s.Type)
+	}
 }
 
 // Verify verifies that sig is the correct signature for b given
-// SignatureKeyPair s.
+// SignatureKeyPair s. sig may also be a signify-style "Ed" + 8-byte
+// key-id + signature blob, as produced by WrapSignifySignature for a
+// public key loaded with ImportSignifyPublicKey -- in that case the
+// signature is rejected outright if its leading key-id doesn't match
+// s.Public, even if the inner ed25519 signature would otherwise verify.
 func (e *Engine) Verify(s SignatureKeyPair, b, sig []byte) bool {
-	return ed25519.Verify(s.Public, b, sig)
+	if keyID, inner, ok := splitSignifySignature(sig); ok {
+		if !hmac.Equal(keyID, signifyKeyID(s.Public)) {
+			return false
+		}
+
+		sig = inner
+	}
+
+	ok, err := VerifySignature(EdDSA, s.Public, b, sig)
+	return err == nil && ok
 }
 
 // SignedEnvelope returns a new SignedEnvelope containing body
@@ -161,7 +418,8 @@ func (e *Engine) SignedEnvelope(body identity.Identifiable,
 		return nil, err
 	}
 
-	s, err := e.Sign(*sigKP, append([]byte(strconv.Itoa(body.Version())), b...))
+	algorithm, s, err := e.sign(*sigKP,
+		append([]byte(strconv.Itoa(body.Version())), b...))
 	if err != nil {
 		return nil, err
 	}
@@ -169,7 +427,7 @@ func (e *Engine) SignedEnvelope(body identity.Identifiable,
 	sv := base64.Value(s)
 	sig := primitive.Signature{
 		PublicKeyID: sigID,
-		Algorithm:   EdDSA,
+		Algorithm:   algorithm,
 		Value:       &sv,
 	}
 
@@ -221,4 +479,4 @@ func deriveKey(mk, nonce []byte) []byte {
 
 	h.Sum(mk)
 	return h.Sum(nil)
-}
\ No newline at end of file
+}
@@ -0,0 +1,122 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// These constants follow the Ledger ed25519 app's APDU conventions: a
+// fixed CLA, an INS per operation, and P1 used as a confirm-on-device
+// flag for GET_PUBLIC_KEY (or, for SIGN, a continuation flag -- see
+// p1Continue).
+const (
+	claEd25519 = 0xE0
+
+	insGetPublicKey = 0x02
+	insSign         = 0x04
+
+	p1NoConfirm = 0x00
+	p1Confirm   = 0x01
+
+	// maxAPDUDataSize is the largest payload the single-byte Lc field in
+	// an APDU can describe.
+	maxAPDUDataSize = 0xFF
+
+	// p1Continue, ORed into a SIGN APDU's P1 byte, tells the device that
+	// another APDU carrying the rest of the message follows this one.
+	// The final chunk leaves it unset.
+	p1Continue = 0x80
+)
+
+// encodePath turns a "44'/535348'/0'/0'" style derivation path into the
+// length-prefixed big-endian uint32 sequence the app expects, with the
+// hardened bit set for each "'"-suffixed component.
+func encodePath(path string) ([]byte, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+
+	out := []byte{byte(len(parts))}
+	for _, p := range parts {
+		hardened := strings.HasSuffix(p, "'")
+		p = strings.TrimSuffix(p, "'")
+
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("ledger: invalid derivation path %q: %s", path, err)
+		}
+
+		if hardened {
+			n |= 0x80000000
+		}
+
+		out = append(out, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+
+	return out, nil
+}
+
+// getPublicKeyAPDU builds a GET_PUBLIC_KEY command for the already-encoded
+// derivation path pathBytes. pathBytes must be short enough, combined
+// with its own length prefix, to fit the single-byte Lc field -- true for
+// any realistic BIP32 path.
+func getPublicKeyAPDU(pathBytes []byte, confirm bool) []byte {
+	p1 := byte(p1NoConfirm)
+	if confirm {
+		p1 = p1Confirm
+	}
+
+	return append([]byte{claEd25519, insGetPublicKey, p1, 0x00, byte(len(pathBytes))}, pathBytes...)
+}
+
+// signAPDUs builds the sequence of SIGN commands needed to deliver
+// pathBytes followed by msg, chunked so no single APDU's data exceeds
+// maxAPDUDataSize (the path and a typical envelope body routinely
+// exceed that together). Every chunk but the last sets p1Continue; the
+// device returns the actual signature only in its response to the last
+// one.
+func signAPDUs(pathBytes, msg []byte) [][]byte {
+	remaining := append(append([]byte(nil), pathBytes...), msg...)
+
+	var chunks [][]byte
+	for {
+		n := len(remaining)
+		if n > maxAPDUDataSize {
+			n = maxAPDUDataSize
+		}
+
+		chunks = append(chunks, remaining[:n])
+		remaining = remaining[n:]
+
+		if len(remaining) == 0 {
+			break
+		}
+	}
+
+	apdus := make([][]byte, len(chunks))
+	for i, data := range chunks {
+		p1 := byte(0x00)
+		if i < len(chunks)-1 {
+			p1 = p1Continue
+		}
+
+		apdus[i] = append([]byte{claEd25519, insSign, p1, 0x00, byte(len(data))}, data...)
+	}
+
+	return apdus
+}
+
+func parsePublicKeyResponse(resp []byte) (ed25519.PublicKey, error) {
+	if len(resp) < 1+ed25519.PublicKeySize {
+		return nil, errors.New("ledger: malformed public key response")
+	}
+
+	keyLen := int(resp[0])
+	if keyLen != ed25519.PublicKeySize || len(resp) < 1+keyLen {
+		return nil, errors.New("ledger: malformed public key response")
+	}
+
+	return ed25519.PublicKey(resp[1 : 1+keyLen]), nil
+}
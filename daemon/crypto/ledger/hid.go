@@ -0,0 +1,46 @@
+package ledger
+
+import (
+	"github.com/karalabe/hid"
+)
+
+// ledgerVendorID is Ledger SAS's registered USB vendor ID.
+const ledgerVendorID = 0x2c97
+
+// hidTransport adapts a karalabe/hid device to the Transport interface.
+type hidTransport struct {
+	dev *hid.Device
+}
+
+func (t *hidTransport) Exchange(apdu []byte) ([]byte, error) {
+	if _, err := t.dev.Write(apdu); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 64)
+	n, err := t.dev.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf[:n], nil
+}
+
+func (t *hidTransport) Close() error {
+	return t.dev.Close()
+}
+
+// openHID finds the first attached Ledger device and opens a raw HID
+// connection to it.
+func openHID() (Transport, error) {
+	for _, info := range hid.Enumerate(ledgerVendorID, 0) {
+		dev, err := info.Open()
+		if err != nil {
+			continue
+		}
+
+		return &hidTransport{dev: dev}, nil
+	}
+
+	return nil, ErrNoDevice
+}
@@ -0,0 +1,106 @@
+// Package ledger implements a Signer for ed25519 keys held on a Ledger
+// hardware wallet, communicating with the device over USB HID.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// Transport exchanges a single APDU command with a connected device and
+// returns its response. It exists so the HID link can be swapped for a
+// fake in tests without a physical Ledger attached.
+type Transport interface {
+	Exchange(apdu []byte) ([]byte, error)
+	Close() error
+}
+
+// ErrNoDevice is returned by Open when no Ledger device can be found.
+var ErrNoDevice = errors.New("ledger: no device found")
+
+// Device is a Ledger hardware wallet, opened at a particular BIP32
+// derivation path.
+type Device struct {
+	transport Transport
+	pathBytes []byte
+}
+
+// Open locates the first attached Ledger device and readies it for use
+// at the given BIP32 derivation path (e.g. "44'/535348'/0'/0'").
+func Open(path string) (*Device, error) {
+	t, err := openHID()
+	if err != nil {
+		return nil, err
+	}
+
+	dev, err := OpenWithTransport(t, path)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+
+	return dev, nil
+}
+
+// OpenWithTransport wraps an already-connected Transport as a Device, at
+// the given derivation path. Used directly by tests with a fake
+// Transport. path is validated up front, so a malformed path is reported
+// here rather than surfacing later as a panic from PublicKey or Sign. On
+// error, t is left open -- the caller retains ownership of it.
+func OpenWithTransport(t Transport, path string) (*Device, error) {
+	pathBytes, err := encodePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Device{transport: t, pathBytes: pathBytes}, nil
+}
+
+// PublicKey asks the device to derive and return the ed25519 public key
+// for d's path, without requiring on-device confirmation.
+func (d *Device) PublicKey() (ed25519.PublicKey, error) {
+	resp, err := d.transport.Exchange(getPublicKeyAPDU(d.pathBytes, false))
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := parsePublicKeyResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return pub, nil
+}
+
+// Sign asks the device to sign msg with the private key at d's path,
+// chunking the request across multiple APDUs if msg -- together with the
+// encoded path -- is too large for a single one. The call blocks until
+// the user approves or rejects the request on the device itself; only
+// the response to the final APDU carries the signature.
+func (d *Device) Sign(msg []byte) ([]byte, error) {
+	apdus := signAPDUs(d.pathBytes, msg)
+
+	var resp []byte
+	for _, apdu := range apdus {
+		r, err := d.transport.Exchange(apdu)
+		if err != nil {
+			return nil, err
+		}
+
+		resp = r
+	}
+
+	if len(resp) != ed25519.SignatureSize {
+		return nil, fmt.Errorf(
+			"ledger: unexpected signature length %d", len(resp))
+	}
+
+	return resp, nil
+}
+
+// Close releases the underlying HID connection.
+func (d *Device) Close() error {
+	return d.transport.Close()
+}
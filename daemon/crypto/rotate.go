@@ -0,0 +1,118 @@
+package crypto
+
+import (
+	"crypto/rand"
+
+	"github.com/dchest/blake2b"
+
+	"github.com/arigatomachine/cli/daemon/base64"
+	"github.com/arigatomachine/cli/daemon/db"
+	"github.com/arigatomachine/cli/daemon/envelope"
+	"github.com/arigatomachine/cli/daemon/primitive"
+)
+
+// masterKeySize is the size, in bytes, of a freshly generated master key.
+const masterKeySize = 32
+
+// keyVersionCurrent is the sealed-blob layout Seal writes: the returned
+// ciphertext is prefixed with this byte. Unseal checks for it so it can
+// also accept legacy blobs, sealed before key versioning existed, which
+// carry no prefix byte at all.
+const keyVersionCurrent byte = 1
+
+// RotateMasterKey replaces the user's master key with a freshly generated
+// one, wraps it with a triplesec cipher derived from newPassphrase, and
+// re-seals every local private key half in kps (both signature and
+// encryption) from the old master key onto the new one. The wrapped
+// master key and every re-sealed KeyPairs are written in a single DB
+// transaction, so a crash or error partway through leaves the old master
+// key and its keypairs completely untouched rather than stranding blobs
+// under a master key the DB no longer holds. Each KeyPairs in kps is
+// written back to its own ID, not the session's.
+func (e *Engine) RotateMasterKey(newPassphrase []byte, kps []*KeyPairs) error {
+	oldMK, err := e.unsealMasterKey()
+	if err != nil {
+		return err
+	}
+
+	newMK := make([]byte, masterKeySize)
+	if _, err := rand.Read(newMK); err != nil {
+		return err
+	}
+
+	wrapped, err := newTriplesec(newPassphrase).Encrypt(newMK)
+	if err != nil {
+		return err
+	}
+
+	return e.db.Transact(func(tx *db.Tx) error {
+		self := envelope.Unsigned{}
+		if err := tx.Get(e.sess.ID(), &self); err != nil {
+			return err
+		}
+
+		user := self.Body.(*primitive.User)
+		wv := base64.Value(wrapped)
+		user.Master.Value = &wv
+
+		if err := tx.Set(e.sess.ID(), &self); err != nil {
+			return err
+		}
+
+		for _, kp := range kps {
+			if err := reencryptPrivate(&kp.Signature.Private, &kp.Signature.PNonce, oldMK, newMK); err != nil {
+				return err
+			}
+
+			if err := reencryptPrivate(&kp.Encryption.Private, &kp.Encryption.PNonce, oldMK, newMK); err != nil {
+				return err
+			}
+
+			if err := tx.Set(kp.ID, kp); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// reencryptPrivate unseals the blob at *private/*nonce under oldMK and
+// reseals it under newMK with a fresh nonce, bringing a legacy blob up to
+// keyVersionCurrent in the process.
+func reencryptPrivate(private, nonce *[]byte, oldMK, newMK []byte) error {
+	pt, err := unsealWithKey(*private, *nonce, oldMK)
+	if err != nil {
+		return err
+	}
+
+	ct, n, err := sealWithKey(pt, newMK)
+	if err != nil {
+		return err
+	}
+
+	*private = ct
+	*nonce = n
+	return nil
+}
+
+// MasterKeyFingerprint returns a blake2b digest of the user's plaintext
+// master key, so higher layers can detect drift (e.g. a rotation that
+// happened on another device) without ever seeing the key itself.
+func (e *Engine) MasterKeyFingerprint() ([]byte, error) {
+	mk, err := e.unsealMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := blake2b.New(&blake2b.Config{Size: blakeSize})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := h.Write(mk); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
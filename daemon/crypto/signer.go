@@ -0,0 +1,125 @@
+package crypto
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// EdDSA is the algorithm name ed25519 signatures are registered and
+// stored under, in primitive.Signature.Algorithm.
+const EdDSA = "eddsa"
+
+// Signer produces signatures over arbitrary messages, and exposes the
+// PublicKey needed to verify them. Local, hardware-backed, and agent- or
+// offline-delegated keys all implement this the same way, so
+// SignedEnvelope doesn't need to know which kind of key it was given.
+type Signer interface {
+	// Public returns the PublicKey half of this Signer.
+	Public() PublicKey
+
+	// Sign signs msg, returning the algorithm it was signed with (a key
+	// in the algorithm registry) and the raw signature bytes.
+	Sign(msg []byte) (algorithm string, sig []byte, err error)
+}
+
+// PublicKey verifies signatures produced by a Signer, and names the
+// algorithm it implements.
+type PublicKey interface {
+	// Verify reports whether sig is a valid signature of msg.
+	Verify(msg, sig []byte) bool
+
+	// Algorithm returns the name this PublicKey's scheme is registered
+	// under. See RegisterAlgorithm.
+	Algorithm() string
+}
+
+// pubKeyFactory decodes a PublicKey's raw encoded bytes, as read from a
+// primitive.Signature.
+type pubKeyFactory func(raw []byte) (PublicKey, error)
+
+// algorithms maps a primitive.Signature.Algorithm value to the factory
+// that can decode a PublicKey for it. Backends register themselves here
+// from an init function, so new schemes (secp256k1, RSA, hardware-backed)
+// can be added without touching envelope code.
+var algorithms = map[string]pubKeyFactory{}
+
+// RegisterAlgorithm adds a signature algorithm to the registry, keyed by
+// the name that will appear in primitive.Signature.Algorithm.
+func RegisterAlgorithm(name string, factory pubKeyFactory) {
+	algorithms[name] = factory
+}
+
+// NewPublicKey looks up the algorithm registered under name and decodes
+// raw into a PublicKey.
+func NewPublicKey(name string, raw []byte) (PublicKey, error) {
+	factory, ok := algorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("crypto: unknown signature algorithm %q", name)
+	}
+
+	return factory(raw)
+}
+
+// VerifySignature verifies sig over b using the raw-encoded public key
+// pub, dispatching to whichever algorithm is registered under name --
+// e.g. a primitive.Signature's Algorithm field, as read off an
+// unmarshalled envelope. This is the registry-backed verification path;
+// Engine.Verify is a thin wrapper around it for the common ed25519 case.
+func VerifySignature(name string, pub, b, sig []byte) (bool, error) {
+	key, err := NewPublicKey(name, pub)
+	if err != nil {
+		return false, err
+	}
+
+	return key.Verify(b, sig), nil
+}
+
+func init() {
+	RegisterAlgorithm(EdDSA, func(raw []byte) (PublicKey, error) {
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf(
+				"crypto: invalid eddsa public key length %d", len(raw))
+		}
+
+		return ed25519PublicKey(raw), nil
+	})
+}
+
+// ed25519PublicKey is the ed25519 PublicKey implementation.
+type ed25519PublicKey ed25519.PublicKey
+
+func (p ed25519PublicKey) Verify(msg, sig []byte) bool {
+	return ed25519.Verify(ed25519.PublicKey(p), msg, sig)
+}
+
+func (p ed25519PublicKey) Algorithm() string {
+	return EdDSA
+}
+
+// localEd25519Signer is a Signer backed by a SignatureKeyPair whose
+// private half is sealed locally with triplesec under the user's master
+// key.
+type localEd25519Signer struct {
+	engine *Engine
+	kp     SignatureKeyPair
+}
+
+// NewSigner returns the Signer for kp, unsealing its private key with e's
+// master key whenever Sign is called.
+func (e *Engine) NewSigner(kp SignatureKeyPair) Signer {
+	return &localEd25519Signer{engine: e, kp: kp}
+}
+
+func (s *localEd25519Signer) Public() PublicKey {
+	return ed25519PublicKey(s.kp.Public)
+}
+
+func (s *localEd25519Signer) Sign(msg []byte) (string, []byte, error) {
+	priv, err := s.engine.Unseal(s.kp.Private, s.kp.PNonce)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return EdDSA, ed25519.Sign(priv, msg), nil
+}
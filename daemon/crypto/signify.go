@@ -0,0 +1,204 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/dchest/bcrypt_pbkdf"
+	"golang.org/x/crypto/ed25519"
+)
+
+// signifyPKAlg and signifyKDFAlg are the two-byte algorithm tags used by
+// OpenBSD's signify tool, which this format borrows its on-disk layout
+// from.
+const (
+	signifyPKAlg  = "Ed"
+	signifyKDFAlg = "BK"
+
+	signifySaltSize     = 16
+	signifyChecksumSize = 8
+	signifyKeyIDSize    = 8
+
+	signifyPrivHeaderSize = 2 + 2 + 4 + signifySaltSize + signifyChecksumSize
+	signifyPrivBlobSize   = signifyPrivHeaderSize + ed25519.PrivateKeySize
+
+	signifyPubBlobSize = 2 + signifyKeyIDSize + ed25519.PublicKeySize
+)
+
+// ExportSignifyKey encrypts kp's ed25519 private key into a base64,
+// OpenBSD-signify-style keyfile, so it can be backed up outside of Torus
+// and later reimported with ImportSignifyKey using a widely-audited KDF
+// instead of triplesec. kp.Private must be the raw, unsealed 64-byte
+// ed25519 private key -- unseal it with Engine.Unseal first. rounds is
+// the bcrypt_pbkdf cost factor (42 is a reasonable default); rounds == 0
+// produces an unencrypted file.
+func ExportSignifyKey(kp *SignatureKeyPair, passphrase []byte, rounds int) ([]byte, error) {
+	if len(kp.Private) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf(
+			"crypto: signify export needs an unsealed %d-byte private key",
+			ed25519.PrivateKeySize)
+	}
+
+	if rounds < 0 {
+		return nil, errors.New("crypto: rounds must be >= 0")
+	}
+
+	salt := make([]byte, signifySaltSize)
+	if rounds > 0 {
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+	}
+
+	sum := sha512.Sum512_256(kp.Private)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(signifyPKAlg)
+	buf.WriteString(signifyKDFAlg)
+	if err := binary.Write(buf, binary.BigEndian, uint32(rounds)); err != nil {
+		return nil, err
+	}
+	buf.Write(salt)
+	buf.Write(sum[:signifyChecksumSize])
+	buf.Write(kp.Private)
+
+	raw := buf.Bytes()
+	if rounds > 0 {
+		stream, err := bcrypt_pbkdf.Key(passphrase, salt, rounds, ed25519.PrivateKeySize)
+		if err != nil {
+			return nil, err
+		}
+
+		xorBytes(raw[signifyPrivHeaderSize:], stream)
+	}
+
+	return []byte(base64.StdEncoding.EncodeToString(raw) + "\n"), nil
+}
+
+// ImportSignifyKey decrypts blob, a keyfile produced by ExportSignifyKey,
+// and returns the recovered SignatureKeyPair with Private set to the raw
+// (unsealed) ed25519 private key. The caller is responsible for sealing
+// it with Engine.Seal before persisting it alongside other Torus keys.
+func ImportSignifyKey(blob, passphrase []byte) (*SignatureKeyPair, error) {
+	raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(blob)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) != signifyPrivBlobSize {
+		return nil, fmt.Errorf(
+			"crypto: malformed signify key (expected %d bytes, got %d)",
+			signifyPrivBlobSize, len(raw))
+	}
+
+	if string(raw[0:2]) != signifyPKAlg || string(raw[2:4]) != signifyKDFAlg {
+		return nil, errors.New("crypto: unrecognized signify key header")
+	}
+
+	rounds := binary.BigEndian.Uint32(raw[4:8])
+	salt := raw[8 : 8+signifySaltSize]
+	wantSum := raw[8+signifySaltSize : signifyPrivHeaderSize]
+	priv := append([]byte(nil), raw[signifyPrivHeaderSize:]...)
+
+	if rounds > 0 {
+		stream, err := bcrypt_pbkdf.Key(passphrase, salt, int(rounds), ed25519.PrivateKeySize)
+		if err != nil {
+			return nil, err
+		}
+
+		xorBytes(priv, stream)
+	}
+
+	sum := sha512.Sum512_256(priv)
+	if !hmac.Equal(sum[:signifyChecksumSize], wantSum) {
+		return nil, errors.New("crypto: wrong passphrase or corrupt signify key")
+	}
+
+	pub := ed25519.PrivateKey(priv).Public().(ed25519.PublicKey)
+
+	return &SignatureKeyPair{
+		Public:  pub,
+		Private: priv,
+	}, nil
+}
+
+// signifyKeyID derives the 8-byte key-id signify keyfiles and wrapped
+// signatures are tagged with: the first signifyKeyIDSize bytes of
+// sha256(pub).
+func signifyKeyID(pub ed25519.PublicKey) []byte {
+	id := sha256.Sum256(pub)
+	return id[:signifyKeyIDSize]
+}
+
+// ExportSignifyPublicKey encodes pub as a signify-style public key
+// keyfile, prefixed with an 8-byte key-id derived from sha256(pub) so
+// Engine.Verify can reject signatures that don't claim to come from this
+// key.
+func ExportSignifyPublicKey(pub ed25519.PublicKey) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(signifyPKAlg)
+	buf.Write(signifyKeyID(pub))
+	buf.Write(pub)
+
+	return []byte(base64.StdEncoding.EncodeToString(buf.Bytes()) + "\n")
+}
+
+// ImportSignifyPublicKey decodes a public keyfile produced by
+// ExportSignifyPublicKey.
+func ImportSignifyPublicKey(blob []byte) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(blob)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) != signifyPubBlobSize {
+		return nil, fmt.Errorf(
+			"crypto: malformed signify public key (expected %d bytes, got %d)",
+			signifyPubBlobSize, len(raw))
+	}
+
+	if string(raw[0:2]) != signifyPKAlg {
+		return nil, errors.New("crypto: unrecognized signify public key header")
+	}
+
+	return append(ed25519.PublicKey(nil), raw[2+signifyKeyIDSize:]...), nil
+}
+
+// WrapSignifySignature prefixes sig (a raw ed25519 signature produced by
+// Engine.Sign over a key whose public half is pub) with the signify-style
+// "Ed" + 8-byte key-id header ExportSignifyPublicKey uses, so it can be
+// handed to a counterpart alongside that exported public key and checked
+// with Engine.Verify.
+func WrapSignifySignature(pub ed25519.PublicKey, sig []byte) []byte {
+	wrapped := make([]byte, 0, 2+signifyKeyIDSize+len(sig))
+	wrapped = append(wrapped, signifyPKAlg...)
+	wrapped = append(wrapped, signifyKeyID(pub)...)
+	wrapped = append(wrapped, sig...)
+
+	return wrapped
+}
+
+// splitSignifySignature reports whether sig has the signify-style "Ed" +
+// 8-byte key-id + 64-byte signature layout WrapSignifySignature produces,
+// returning the embedded key-id and the inner ed25519 signature if so.
+func splitSignifySignature(sig []byte) (keyID, inner []byte, ok bool) {
+	if len(sig) != 2+signifyKeyIDSize+ed25519.SignatureSize || string(sig[0:2]) != signifyPKAlg {
+		return nil, nil, false
+	}
+
+	return sig[2 : 2+signifyKeyIDSize], sig[2+signifyKeyIDSize:], true
+}
+
+// xorBytes XORs key into dst in place. len(key) must be >= len(dst).
+func xorBytes(dst, key []byte) {
+	for i := range dst {
+		dst[i] ^= key[i]
+	}
+}
@@ -0,0 +1,76 @@
+// Package sshagent implements a Signer for ed25519 keys held by a
+// running ssh-agent, reached over SSH_AUTH_SOCK.
+package sshagent
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Dial connects to the ssh-agent listening on SSH_AUTH_SOCK.
+func Dial() (agent.Agent, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, fmt.Errorf("sshagent: SSH_AUTH_SOCK is not set")
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, fmt.Errorf("sshagent: could not connect to %s: %s", sock, err)
+	}
+
+	return agent.NewClient(conn), nil
+}
+
+// FindEd25519Key looks through ag's keys for an ed25519 key whose comment
+// or hex fingerprint matches id, returning the matching agent key and its
+// raw public key.
+func FindEd25519Key(ag agent.Agent, id string) (*agent.Key, ed25519.PublicKey, error) {
+	keys, err := ag.List()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, k := range keys {
+		if k.Type() != ssh.KeyAlgoED25519 {
+			continue
+		}
+
+		pk, err := ssh.ParsePublicKey(k.Blob)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if k.Comment != id && ssh.FingerprintSHA256(pk) != id {
+			continue
+		}
+
+		pub, err := publicKey(k.Comment, pk)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return k, pub, nil
+	}
+
+	return nil, nil, fmt.Errorf("sshagent: no ed25519 key in agent matches %q", id)
+}
+
+func publicKey(comment string, pk ssh.PublicKey) (ed25519.PublicKey, error) {
+	cpk, ok := pk.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("sshagent: key %q is not a crypto public key", comment)
+	}
+
+	pub, ok := cpk.CryptoPublicKey().(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("sshagent: key %q is not ed25519", comment)
+	}
+
+	return pub, nil
+}